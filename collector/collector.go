@@ -1,9 +1,13 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -22,6 +26,11 @@ var (
 		"Can be test_server reached",
 		[]string{"collector"}, nil,
 	)
+	scrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
+		"github_billing_exporter: Duration of a collector scrape.",
+		[]string{"collector"}, nil,
+	)
 )
 
 var (
@@ -35,18 +44,56 @@ var (
 		"github-token",
 		"GitHub token to access api",
 	).Envar("GITHUB_TOKEN").String()
+	githubTokens = kingpin.Flag(
+		"github-tokens",
+		"Comma-separated list of GitHub tokens to access api. Takes precedence over --github-token when set.",
+	).Envar("GITHUB_TOKENS").String()
 	githubOrgs = kingpin.Flag("github-orgs",
 		"Organizations to get metrics from",
 	).Envar("GITHUB_ORGS").String()
+	disableDefaultCollectors = kingpin.Flag(
+		"collector.disable-defaults",
+		"Set all collectors to disabled by default.",
+	).Default("false").Bool()
+	scrapeTimeout = kingpin.Flag(
+		"scrape.timeout",
+		"Maximum duration a single collector is allowed to run; the context passed to its Update is canceled once it is exceeded.",
+	).Default("10s").Duration()
 )
 
+var (
+	tokensMu sync.RWMutex
+	tokens   *tokenPool
+)
+
+// Tokens returns the pool collectors should draw GitHub tokens from. It is
+// populated by NewBillingCollector from the --github-app-* flags when
+// --github-app-id is set, otherwise from --github-tokens (falling back to
+// --github-token), and may be swapped out by Reload. Access goes through
+// tokensMu so a Reload running concurrently with an in-flight scrape can't
+// race a collector's Tokens().Get() call.
+func Tokens() *tokenPool {
+	tokensMu.RLock()
+	defer tokensMu.RUnlock()
+	return tokens
+}
+
+func setTokens(p *tokenPool) {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	tokens = p
+}
+
 type Collector interface {
-	Update(ch chan<- prometheus.Metric) error
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
 }
 
 type BillingCollector struct {
-	Collectors map[string]Collector
-	logger     log.Logger
+	logger log.Logger
+
+	mu                  sync.Mutex
+	initiatedCollectors map[string]Collector
+	disabledLogged      map[string]bool
 }
 
 func registerCollector(collector string, isDefaultEnabled bool, factory func(logger log.Logger) (Collector, error)) {
@@ -65,54 +112,170 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 	factories[collector] = factory
 }
 
-func NewBillingCollector(logger log.Logger) (*BillingCollector, error) {
-	collectors := make(map[string]Collector)
-	for key, enabled := range collectorState {
-		if *enabled {
-			collector, err := factories[key](log.With(logger, "collector", key))
-			if err != nil {
-				return nil, err
-			}
-			collectors[key] = collector
+// DisableDefaultCollectors sets the collector state to false for all collectors which
+// have not been explicitly enabled or disabled on the command line.
+func DisableDefaultCollectors() {
+	for c := range collectorState {
+		if _, ok := forcedCollectors[c]; !ok {
+			*collectorState[c] = false
 		}
-		if !*enabled {
-			level.Info(logger).Log("msg", "Collector disabled", "name", key)
+	}
+}
+
+// resolveGitHubTokens returns the configured PAT(s). It re-reads
+// GITHUB_TOKENS/GITHUB_TOKEN from the environment on every call, since
+// kingpin resolves *githubTokens/*githubToken once at Parse() and would
+// otherwise never see a token rotated into the environment after startup;
+// it falls back to the parsed flag values for tokens passed on the command
+// line rather than through the environment.
+func resolveGitHubTokens() string {
+	if raw := os.Getenv("GITHUB_TOKENS"); raw != "" {
+		return raw
+	}
+	if *githubTokens != "" {
+		return *githubTokens
+	}
+	if raw := os.Getenv("GITHUB_TOKEN"); raw != "" {
+		return raw
+	}
+	return *githubToken
+}
+
+// buildTokenPool constructs the tokenPool described by the current
+// --github-app-* / --github-tokens / --github-token configuration,
+// returning an error (rather than an empty pool) if no credentials were
+// configured, since every Tokens().Get() call on an empty pool would
+// otherwise fail. Callers are expected to treat that error as fatal. If
+// previous is non-nil, its rate-limit state is carried over for unchanged
+// tokens; see mergeRateLimitState.
+func buildTokenPool(previous *tokenPool) (*tokenPool, error) {
+	if *githubAppID != 0 {
+		pool := newAppTokenPool(newGitHubAppTokenSource(*githubAppID, *githubAppInstallationID, *githubAppPrivateKeyFile))
+		if previous != nil {
+			pool.mergeRateLimitState(previous)
 		}
+		return pool, nil
+	}
+
+	pool := newTokenPool(strings.Split(resolveGitHubTokens(), ","))
+	if len(pool.tokens) == 0 {
+		return nil, fmt.Errorf("no GitHub credentials configured: set --github-token, --github-tokens, or --github-app-id")
+	}
+	if previous != nil {
+		pool.mergeRateLimitState(previous)
 	}
+	return pool, nil
+}
+
+func NewBillingCollector(logger log.Logger) (*BillingCollector, error) {
+	if *disableDefaultCollectors {
+		DisableDefaultCollectors()
+	}
+
+	pool, err := buildTokenPool(nil)
+	if err != nil {
+		return nil, err
+	}
+	setTokens(pool)
 
 	return &BillingCollector{
-		Collectors: collectors,
-		logger:     logger,
+		logger:              logger,
+		initiatedCollectors: make(map[string]Collector),
+		disabledLogged:      make(map[string]bool),
 	}, nil
 }
 
-func (n BillingCollector) Describe(ch chan<- *prometheus.Desc) {
+// Reload drops all cached collector instances and rebuilds the Tokens
+// pool from the current flags/env, forcing the next scrape to re-invoke
+// factories with fresh credentials. This lets operators rotate the
+// GITHUB_TOKEN (e.g. on SIGHUP or via a /-/reload endpoint) without
+// restarting the exporter process. Reload does not re-parse command-line
+// flags: collectorState, which every scrape reads, keeps its current values.
+func (n *BillingCollector) Reload() error {
+	pool, err := buildTokenPool(Tokens())
+	if err != nil {
+		return err
+	}
+	setTokens(pool)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.initiatedCollectors = make(map[string]Collector)
+	return nil
+}
+
+// getCollectors returns the set of currently enabled collectors, lazily
+// instantiating and caching each one on its first use.
+func (n *BillingCollector) getCollectors() map[string]Collector {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	collectors := make(map[string]Collector, len(n.initiatedCollectors))
+	for key, enabled := range collectorState {
+		if !*enabled {
+			if !n.disabledLogged[key] {
+				level.Info(n.logger).Log("msg", "Collector disabled", "name", key)
+				n.disabledLogged[key] = true
+			}
+			delete(n.initiatedCollectors, key)
+			continue
+		}
+		delete(n.disabledLogged, key)
+
+		collector, ok := n.initiatedCollectors[key]
+		if !ok {
+			var err error
+			collector, err = factories[key](log.With(n.logger, "collector", key))
+			if err != nil {
+				level.Error(n.logger).Log("msg", "Couldn't create collector", "name", key, "err", err)
+				continue
+			}
+			n.initiatedCollectors[key] = collector
+		}
+		collectors[key] = collector
+	}
+	return collectors
+}
+
+func (n *BillingCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- up
+	ch <- scrapeDurationDesc
+	Tokens().Describe(ch)
 }
 
-func (n BillingCollector) Collect(ch chan<- prometheus.Metric) {
+func (n *BillingCollector) Collect(ch chan<- prometheus.Metric) {
+	collectors := n.getCollectors()
 	wg := sync.WaitGroup{}
-	wg.Add(len(n.Collectors))
-	for name, c := range n.Collectors {
+	wg.Add(len(collectors))
+	for name, c := range collectors {
 		go func(name string, c Collector) {
 			execute(name, c, ch, n.logger)
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
+
+	Tokens().Collect(ch)
 }
 
 func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), *scrapeTimeout)
+	defer cancel()
+
+	begin := time.Now()
+	err := c.Update(ctx, ch)
+	duration := time.Since(begin)
 	var success float64
 
-	err := c.Update(ch)
 	if err != nil {
-		level.Error(logger).Log("msg", "Cannot collect metrics", "err", err)
+		level.Error(logger).Log("msg", "Cannot collect metrics", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		success = 0
 	} else {
+		level.Debug(logger).Log("msg", "Collector succeeded", "name", name, "duration_seconds", duration.Seconds())
 		success = 1
 	}
 
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(up, prometheus.GaugeValue, success, name)
 }
 
@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	githubAppID = kingpin.Flag(
+		"github-app-id",
+		"GitHub App ID to use for installation-token authentication, instead of a personal access token.",
+	).Envar("GITHUB_APP_ID").Int64()
+	githubAppInstallationID = kingpin.Flag(
+		"github-app-installation-id",
+		"GitHub App installation ID to mint installation tokens for.",
+	).Envar("GITHUB_APP_INSTALLATION_ID").Int64()
+	githubAppPrivateKeyFile = kingpin.Flag(
+		"github-app-private-key-file",
+		"Path to the PEM-encoded private key of the GitHub App.",
+	).Envar("GITHUB_APP_PRIVATE_KEY_FILE").String()
+)
+
+// installationTokenRefreshBuffer is how long before an installation
+// token's reported expiry it is proactively replaced, so a scrape never
+// races the token's actual expiration.
+const installationTokenRefreshBuffer = 5 * time.Minute
+
+// installationTokenHTTPClient bounds the installation-token exchange
+// request so a hung GitHub API call can't stall a scrape indefinitely.
+var installationTokenHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// githubAppTokenSource mints short-lived GitHub App installation tokens
+// and transparently refreshes them before they expire, rather than
+// relying on a single long-lived personal access token.
+type githubAppTokenSource struct {
+	appID          int64
+	installationID int64
+	privateKeyFile string
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// newGitHubAppTokenSource returns a tokenSource which mints GitHub App
+// installation tokens for installationID on demand.
+func newGitHubAppTokenSource(appID, installationID int64, privateKeyFile string) *githubAppTokenSource {
+	return &githubAppTokenSource{
+		appID:          appID,
+		installationID: installationID,
+		privateKeyFile: privateKeyFile,
+	}
+}
+
+// Token returns a valid installation token, minting a new one if the
+// cached token is missing or within installationTokenRefreshBuffer of
+// expiring.
+func (s *githubAppTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expiresAt) > installationTokenRefreshBuffer {
+		return s.token, nil
+	}
+
+	appJWT, err := s.signAppJWT()
+	if err != nil {
+		return "", fmt.Errorf("signing github app jwt: %w", err)
+	}
+
+	token, expiresAt, err := s.exchangeInstallationToken(appJWT)
+	if err != nil {
+		return "", fmt.Errorf("exchanging github app installation token: %w", err)
+	}
+
+	s.token = token
+	s.expiresAt = expiresAt
+	return s.token, nil
+}
+
+// signAppJWT mints a short-lived JWT identifying the App itself, as
+// required to request an installation token.
+// See: https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (s *githubAppTokenSource) signAppJWT() (string, error) {
+	keyData, err := ioutil.ReadFile(s.privateKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("reading github app private key: %w", err)
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+	if err != nil {
+		return "", fmt.Errorf("parsing github app private key: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now.Add(-1 * time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+		Issuer:    fmt.Sprintf("%d", s.appID),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(privateKey)
+}
+
+// installationTokenResponse is the subset of GitHub's "Create an
+// installation access token" response this exporter needs.
+type installationTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// exchangeInstallationToken calls the GitHub API to exchange a signed
+// App JWT for a short-lived installation access token.
+func (s *githubAppTokenSource) exchangeInstallationToken(appJWT string) (string, time.Time, error) {
+	url := fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", s.installationID)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appJWT)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := installationTokenHTTPClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", time.Time{}, fmt.Errorf("unexpected status %s minting installation token", resp.Status)
+	}
+
+	var body installationTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, err
+	}
+	return body.Token, body.ExpiresAt, nil
+}
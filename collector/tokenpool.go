@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rateLimitRemainingDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "rate_limit_remaining"),
+		"Number of GitHub API requests remaining for this token in the current rate-limit window.",
+		[]string{"token_id"}, nil,
+	)
+	rateLimitResetDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "rate_limit_reset_seconds"),
+		"Unix time at which the current rate-limit window resets for this token.",
+		[]string{"token_id"}, nil,
+	)
+)
+
+// tokenSource mints a usable GitHub token on demand, refreshing it as
+// needed. It is implemented by githubAppTokenSource for GitHub App
+// installation tokens; static personal access tokens don't need one.
+type tokenSource interface {
+	Token() (string, error)
+}
+
+// poolToken tracks one GitHub token's last observed rate-limit budget. If
+// source is set, Get() asks source for the token value (which source
+// refreshes as needed) instead of using token as-is, to support
+// credentials that expire (e.g. App installation tokens).
+type poolToken struct {
+	id         string
+	token      string
+	source     tokenSource
+	remaining  int
+	reset      time.Time
+	resetKnown bool
+}
+
+// tokenPool hands out GitHub tokens to collectors, preferring whichever
+// token currently has the most remaining rate-limit budget. It is a hook
+// for collector factories to call Get()/ObserveResponse on; no collector
+// in this tree does so yet, so until one is wired up every token stays at
+// its initial assumed budget and Get() always returns tokens[0].
+type tokenPool struct {
+	mu     sync.Mutex
+	tokens []*poolToken
+}
+
+// newTokenPool builds a tokenPool from a list of GitHub tokens. Each token
+// is assigned a stable "tokenN" id (1-indexed) used to label the exported
+// rate-limit metrics, and starts out assumed to have a full rate-limit
+// budget until a collector reports otherwise.
+func newTokenPool(tokens []string) *tokenPool {
+	pool := &tokenPool{}
+	for i, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		pool.tokens = append(pool.tokens, &poolToken{
+			id:        fmt.Sprintf("token%d", i+1),
+			token:     token,
+			remaining: 5000,
+		})
+	}
+	return pool
+}
+
+// newAppTokenPool builds a single-entry tokenPool backed by a GitHub App
+// installation token source instead of a static list of tokens.
+func newAppTokenPool(source *githubAppTokenSource) *tokenPool {
+	return &tokenPool{
+		tokens: []*poolToken{{
+			id:        "app",
+			source:    source,
+			remaining: 5000,
+		}},
+	}
+}
+
+// mergeRateLimitState copies rate-limit budgets from previous into any
+// token in p with a matching id and value, so a rebuilt pool (see
+// buildTokenPool) doesn't forget state for tokens that didn't change.
+func (p *tokenPool) mergeRateLimitState(previous *tokenPool) {
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+
+	byID := make(map[string]*poolToken, len(previous.tokens))
+	for _, t := range previous.tokens {
+		byID[t.id] = t
+	}
+
+	for _, t := range p.tokens {
+		old, ok := byID[t.id]
+		if !ok || old.token != t.token {
+			continue
+		}
+		t.remaining = old.remaining
+		t.reset = old.reset
+		t.resetKnown = old.resetKnown
+	}
+}
+
+// Get returns the id and value of the token with the most remaining
+// rate-limit budget. If that token is backed by a tokenSource (e.g. a
+// GitHub App installation token), it is refreshed first. Get returns an
+// error if the pool has no tokens configured. Not yet called by any
+// collector in this tree.
+func (p *tokenPool) Get() (id string, token string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.tokens) == 0 {
+		return "", "", fmt.Errorf("token pool has no tokens configured")
+	}
+
+	best := p.tokens[0]
+	for _, t := range p.tokens[1:] {
+		if t.remaining > best.remaining {
+			best = t
+		}
+	}
+
+	token = best.token
+	if best.source != nil {
+		refreshed, refreshErr := best.source.Token()
+		if refreshErr != nil {
+			return best.id, "", fmt.Errorf("refreshing token %s: %w", best.id, refreshErr)
+		}
+		token = refreshed
+	}
+	return best.id, token, nil
+}
+
+// Observe records a token's rate-limit budget as reported by a collector.
+// Not yet called by any collector in this tree.
+func (p *tokenPool) Observe(id string, remaining int, reset time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.tokens {
+		if t.id == id {
+			t.remaining = remaining
+			t.reset = reset
+			t.resetKnown = true
+			return
+		}
+	}
+}
+
+// ObserveResponse updates a token's tracked rate-limit budget from the
+// X-RateLimit-Remaining / X-RateLimit-Reset headers of a GitHub API
+// response. Malformed or missing headers are ignored. Not yet called by
+// any collector in this tree.
+func (p *tokenPool) ObserveResponse(id string, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetUnix, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	p.Observe(id, remaining, time.Unix(resetUnix, 0))
+}
+
+// Describe implements prometheus.Collector for the token pool's rate-limit metrics.
+func (p *tokenPool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rateLimitRemainingDesc
+	ch <- rateLimitResetDesc
+}
+
+// Collect implements prometheus.Collector for the token pool's rate-limit metrics.
+func (p *tokenPool) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.tokens {
+		var reset float64
+		if t.resetKnown {
+			reset = float64(t.reset.Unix())
+		}
+		ch <- prometheus.MustNewConstMetric(rateLimitRemainingDesc, prometheus.GaugeValue, float64(t.remaining), t.id)
+		ch <- prometheus.MustNewConstMetric(rateLimitResetDesc, prometheus.GaugeValue, reset, t.id)
+	}
+}